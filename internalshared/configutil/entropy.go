@@ -0,0 +1,96 @@
+// +build !enterprise
+
+package configutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Entropy augmentation modes for the SharedConfig "entropy_augmentation"
+// stanza.
+const (
+	EntropyAugmentationAugmentation = "augmentation"
+	EntropyAugmentationOff          = "off"
+
+	defaultEntropyChunkSize = 32
+)
+
+// EntropyAugmentation configures whether createSecureRandomReader augments
+// the local CSPRNG with entropy pulled from the configured KMS/HSM wrapper.
+type EntropyAugmentation struct {
+	Mode      string `hcl:"mode"`
+	ChunkSize int    `hcl:"chunk_size"`
+}
+
+// EntropySourcer is implemented by wrapper adapters that can pull random
+// bytes directly from their backing HSM or KMS. In this package only the
+// PKCS#11 wrapper of the "softhsm" build implements it, via C_GenerateRandom;
+// the AWS KMS, GCP KMS and Transit wrappers do not, so createSecureRandomReader
+// returns crypto/rand.Reader unaugmented for them.
+type EntropySourcer interface {
+	GetRandom(ctx context.Context, n int) ([]byte, error)
+}
+
+// EntropyAugmentationErrors receives a structured error whenever the KMS
+// entropy source fails and the reader falls back to crypto/rand.Reader
+// alone, so the server can log it without Read itself having to fail.
+var EntropyAugmentationErrors = make(chan error, 1)
+
+// augmentedEntropyReader XORs crypto/rand.Reader output with bytes pulled
+// from an EntropySourcer so that a compromise of either source alone isn't
+// enough to predict the resulting stream.
+type augmentedEntropyReader struct {
+	ctx       context.Context
+	source    EntropySourcer
+	chunkSize int
+
+	// localSource is crypto/rand.Reader in production; tests substitute a
+	// deterministic reader so the XOR invariant can be checked exactly.
+	localSource io.Reader
+}
+
+func (r *augmentedEntropyReader) Read(p []byte) (int, error) {
+	local := make([]byte, len(p))
+	n, err := r.localSource.Read(local)
+	if err != nil {
+		return n, err
+	}
+
+	remote, err := r.drainRemote(len(p))
+	if err != nil {
+		select {
+		case EntropyAugmentationErrors <- fmt.Errorf("entropy augmentation source failed, falling back to local entropy only: %w", err):
+		default:
+		}
+		copy(p, local)
+		return n, nil
+	}
+
+	for i := range p {
+		p[i] = local[i] ^ remote[i]
+	}
+	return n, nil
+}
+
+// drainRemote pulls exactly n bytes of entropy from the KMS source, issuing
+// as many chunkSize-sized calls as required.
+func (r *augmentedEntropyReader) drainRemote(n int) ([]byte, error) {
+	buf := make([]byte, 0, n)
+	for len(buf) < n {
+		want := r.chunkSize
+		if remaining := n - len(buf); remaining < want {
+			want = remaining
+		}
+		chunk, err := r.source.GetRandom(r.ctx, want)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) != want {
+			return nil, fmt.Errorf("entropy source returned %d bytes, wanted %d", len(chunk), want)
+		}
+		buf = append(buf, chunk...)
+	}
+	return buf, nil
+}
@@ -0,0 +1,139 @@
+// +build !enterprise
+
+package configutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeEntropySourcer is an EntropySourcer that serves GetRandom calls from a
+// fixed byte slice, chunk by chunk, recording how many bytes each call asked
+// for so tests can assert on chunking behavior.
+type fakeEntropySourcer struct {
+	data      []byte
+	pos       int
+	callSizes []int
+}
+
+func (f *fakeEntropySourcer) GetRandom(ctx context.Context, n int) ([]byte, error) {
+	if f.pos+n > len(f.data) {
+		return nil, errors.New("fakeEntropySourcer: exhausted")
+	}
+	f.callSizes = append(f.callSizes, n)
+	chunk := f.data[f.pos : f.pos+n]
+	f.pos += n
+	return chunk, nil
+}
+
+// constReader is an io.Reader that always fills p with a fixed byte value,
+// standing in for crypto/rand.Reader so tests can compute the expected XOR
+// result exactly.
+type constReader byte
+
+func (c constReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(c)
+	}
+	return len(p), nil
+}
+
+func TestAugmentedEntropyReader_XOR(t *testing.T) {
+	remote := bytes.Repeat([]byte{0x0F}, 64)
+	source := &fakeEntropySourcer{data: remote}
+
+	r := &augmentedEntropyReader{
+		ctx:         context.Background(),
+		source:      source,
+		chunkSize:   16,
+		localSource: constReader(0xF0),
+	}
+
+	p := make([]byte, 64)
+	n, err := r.Read(p)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if n != len(p) {
+		t.Fatalf("Read returned n=%d, want %d", n, len(p))
+	}
+
+	want := bytes.Repeat([]byte{0xFF}, 64)
+	if !bytes.Equal(p, want) {
+		t.Fatalf("Read output = %x, want %x (local XOR remote)", p, want)
+	}
+
+	if source.pos != len(remote) {
+		t.Fatalf("remote source drained %d of %d bytes, want all of it consumed", source.pos, len(remote))
+	}
+}
+
+func TestAugmentedEntropyReader_DrainsInChunks(t *testing.T) {
+	remote := bytes.Repeat([]byte{0xAA}, 40)
+	source := &fakeEntropySourcer{data: remote}
+
+	r := &augmentedEntropyReader{
+		ctx:         context.Background(),
+		source:      source,
+		chunkSize:   16,
+		localSource: constReader(0x00),
+	}
+
+	p := make([]byte, 40)
+	if _, err := r.Read(p); err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+
+	wantCalls := []int{16, 16, 8}
+	if len(source.callSizes) != len(wantCalls) {
+		t.Fatalf("GetRandom called %d times (%v), want %d calls (%v)", len(source.callSizes), source.callSizes, len(wantCalls), wantCalls)
+	}
+	for i, want := range wantCalls {
+		if source.callSizes[i] != want {
+			t.Fatalf("GetRandom call %d requested %d bytes, want %d", i, source.callSizes[i], want)
+		}
+	}
+}
+
+func TestAugmentedEntropyReader_FallsBackOnRemoteError(t *testing.T) {
+	// Drain the fake source immediately so every GetRandom call fails.
+	source := &fakeEntropySourcer{data: nil}
+
+	r := &augmentedEntropyReader{
+		ctx:         context.Background(),
+		source:      source,
+		chunkSize:   16,
+		localSource: constReader(0x42),
+	}
+
+	// Drain any error left over from a previous test run.
+	select {
+	case <-EntropyAugmentationErrors:
+	default:
+	}
+
+	p := make([]byte, 16)
+	n, err := r.Read(p)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if n != len(p) {
+		t.Fatalf("Read returned n=%d, want %d", n, len(p))
+	}
+
+	want := bytes.Repeat([]byte{0x42}, 16)
+	if !bytes.Equal(p, want) {
+		t.Fatalf("Read output = %x, want local entropy only %x", p, want)
+	}
+
+	select {
+	case err := <-EntropyAugmentationErrors:
+		if err == nil {
+			t.Fatalf("expected a non-nil error on EntropyAugmentationErrors")
+		}
+	default:
+		t.Fatalf("expected an error to be reported on EntropyAugmentationErrors")
+	}
+}
@@ -3,9 +3,12 @@
 package configutil
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
 	"io"
+	"sort"
+	"sync"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-hclog"
@@ -25,47 +28,96 @@ var (
 	CreateSecureRandomReaderFunc = createSecureRandomReader
 )
 
-func configureWrapper(configKMS *KMS, infoKeys *[]string, info *map[string]string, logger hclog.Logger) (wrapping.Wrapper, error) {
-	var wrapper wrapping.Wrapper
-	var kmsInfo map[string]string
-	var err error
-
-	opts := &wrapping.WrapperOptions{
-		Logger: logger,
-	}
+// WrapperFactory builds a wrapping.Wrapper from the given options and KMS
+// config. It's the shape every wrapper provider, built-in or third-party,
+// registers under a KMS type name via RegisterWrapperProvider.
+type WrapperFactory func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error)
 
-	switch configKMS.Type {
-	case wrapping.Shamir:
-		return nil, nil
-
-	case wrapping.AEAD:
-		wrapper, kmsInfo, err = GetAEADKMSFunc(opts, configKMS)
+var (
+	wrapperProvidersLock sync.RWMutex
+	wrapperProviders     = map[string]WrapperFactory{}
+)
 
-	case wrapping.AliCloudKMS:
-		wrapper, kmsInfo, err = GetAliCloudKMSFunc(opts, configKMS)
+// RegisterWrapperProvider registers a WrapperFactory under the given KMS type
+// name (e.g. "awskms"), overwriting any existing registration. It's meant to
+// be called from init() by this package's built-in providers and by
+// downstream forks wiring in third-party backends such as a Yubikey or
+// in-cluster KMS.
+func RegisterWrapperProvider(name string, factory WrapperFactory) {
+	wrapperProvidersLock.Lock()
+	defer wrapperProvidersLock.Unlock()
+	wrapperProviders[name] = factory
+}
 
-	case wrapping.AWSKMS:
-		wrapper, kmsInfo, err = GetAWSKMSFunc(opts, configKMS)
+// UnregisterWrapperProvider removes a previously registered provider, if any.
+func UnregisterWrapperProvider(name string) {
+	wrapperProvidersLock.Lock()
+	defer wrapperProvidersLock.Unlock()
+	delete(wrapperProviders, name)
+}
 
-	case wrapping.AzureKeyVault:
-		wrapper, kmsInfo, err = GetAzureKeyVaultKMSFunc(opts, configKMS)
+// ListWrapperProviders returns the names of all currently registered wrapper
+// providers, sorted for stable output.
+func ListWrapperProviders() []string {
+	wrapperProvidersLock.RLock()
+	defer wrapperProvidersLock.RUnlock()
+	names := make([]string, 0, len(wrapperProviders))
+	for name := range wrapperProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-	case wrapping.GCPCKMS:
-		wrapper, kmsInfo, err = GetGCPCKMSKMSFunc(opts, configKMS)
+func lookupWrapperProvider(name string) (WrapperFactory, bool) {
+	wrapperProvidersLock.RLock()
+	defer wrapperProvidersLock.RUnlock()
+	factory, ok := wrapperProviders[name]
+	return factory, ok
+}
 
-	case wrapping.OCIKMS:
-		wrapper, kmsInfo, err = GetOCIKMSKMSFunc(opts, configKMS)
+func init() {
+	RegisterWrapperProvider(string(wrapping.AEAD), func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
+		return GetAEADKMSFunc(opts, kms)
+	})
+	RegisterWrapperProvider(string(wrapping.AliCloudKMS), func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
+		return GetAliCloudKMSFunc(opts, kms)
+	})
+	RegisterWrapperProvider(string(wrapping.AWSKMS), func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
+		return GetAWSKMSFunc(opts, kms)
+	})
+	RegisterWrapperProvider(string(wrapping.AzureKeyVault), func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
+		return GetAzureKeyVaultKMSFunc(opts, kms)
+	})
+	RegisterWrapperProvider(string(wrapping.GCPCKMS), func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
+		return GetGCPCKMSKMSFunc(opts, kms)
+	})
+	RegisterWrapperProvider(string(wrapping.OCIKMS), func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
+		return GetOCIKMSKMSFunc(opts, kms)
+	})
+	RegisterWrapperProvider(string(wrapping.Transit), func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
+		return GetTransitKMSFunc(opts, kms)
+	})
+}
 
-	case wrapping.Transit:
-		wrapper, kmsInfo, err = GetTransitKMSFunc(opts, configKMS)
+func configureWrapper(configKMS *KMS, infoKeys *[]string, info *map[string]string, logger hclog.Logger) (wrapping.Wrapper, error) {
+	if configKMS.Type == wrapping.Shamir {
+		return nil, nil
+	}
 
-	case wrapping.PKCS11:
-		return nil, fmt.Errorf("KMS type 'pkcs11' requires the Vault Enterprise HSM binary")
+	opts := &wrapping.WrapperOptions{
+		Logger: logger,
+	}
 
-	default:
+	factory, ok := lookupWrapperProvider(string(configKMS.Type))
+	if !ok {
+		if configKMS.Type == wrapping.PKCS11 {
+			return nil, fmt.Errorf("KMS type 'pkcs11' requires the Vault Enterprise HSM binary")
+		}
 		return nil, fmt.Errorf("Unknown KMS type %q", configKMS.Type)
 	}
 
+	wrapper, kmsInfo, err := factory(opts, configKMS)
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +127,13 @@ func configureWrapper(configKMS *KMS, infoKeys *[]string, info *map[string]strin
 		(*info)[k] = v
 	}
 
+	if configKMS.VerifyOnLoad {
+		if err := VerifyWrapper(context.Background(), wrapper); err != nil {
+			wrapper.Finalize(context.Background())
+			return nil, err
+		}
+	}
+
 	return wrapper, nil
 }
 
@@ -132,7 +191,7 @@ var GetAWSKMSFunc = func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrap
 			info["AWS KMS Endpoint"] = endpoint
 		}
 	}
-	return wrapper, info, nil
+	return &awsKeyStatusChecker{wrapper}, info, nil
 }
 
 var GetAzureKeyVaultKMSFunc = func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
@@ -150,7 +209,7 @@ var GetAzureKeyVaultKMSFunc = func(opts *wrapping.WrapperOptions, kms *KMS) (wra
 		info["Azure Vault Name"] = wrapperInfo["vault_name"]
 		info["Azure Key Name"] = wrapperInfo["key_name"]
 	}
-	return wrapper, info, nil
+	return &azureKeyStatusChecker{wrapper, wrapperInfo["key_name"]}, info, nil
 }
 
 var GetGCPCKMSKMSFunc = func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
@@ -169,7 +228,8 @@ var GetGCPCKMSKMSFunc = func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.
 		info["GCP KMS Key Ring"] = wrapperInfo["key_ring"]
 		info["GCP KMS Crypto Key"] = wrapperInfo["crypto_key"]
 	}
-	return wrapper, info, nil
+	cryptoKeyName := wrapper.KeyRingResourceName() + "/cryptoKeys/" + wrapperInfo["crypto_key"]
+	return &gcpKeyStatusChecker{wrapper, cryptoKeyName}, info, nil
 }
 
 var GetOCIKMSKMSFunc = func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
@@ -210,5 +270,24 @@ var GetTransitKMSFunc = func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.
 }
 
 func createSecureRandomReader(conf *SharedConfig, wrapper wrapping.Wrapper) (io.Reader, error) {
-	return rand.Reader, nil
+	if conf.EntropyAugmentation == nil || conf.EntropyAugmentation.Mode != EntropyAugmentationAugmentation {
+		return rand.Reader, nil
+	}
+
+	source, ok := wrapper.(EntropySourcer)
+	if !ok {
+		return rand.Reader, nil
+	}
+
+	chunkSize := conf.EntropyAugmentation.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultEntropyChunkSize
+	}
+
+	return &augmentedEntropyReader{
+		ctx:         context.Background(),
+		source:      source,
+		chunkSize:   chunkSize,
+		localSource: rand.Reader,
+	}, nil
 }
@@ -0,0 +1,274 @@
+// +build !enterprise
+
+package configutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+)
+
+const compositeWrapperEnvelopeVersion byte = 1
+
+// CompositeWrapper composes an ordered list of child wrappers into a single
+// wrapping.Wrapper. Encrypt always uses the first (primary) child; Decrypt
+// dispatches on the key id embedded in the blob to whichever child wrote it.
+// This lets operators rotate between KMS backends, or run redundant seals
+// across clouds, without a flag-day re-encrypt step: ciphertext written by a
+// secondary keeps decrypting after the primary changes.
+//
+// wrapping.Wrapper's Decrypt has no way to hand a caller a re-wrapped blob to
+// persist, so CompositeWrapper doesn't migrate ciphertext on its own; a
+// caller that wants secondary-wrapped values to move to the primary over
+// time should use DecryptWithMigration and write the returned envelope back
+// to storage itself.
+type CompositeWrapper struct {
+	wrappers []wrapping.Wrapper
+}
+
+// NewCompositeWrapper returns a CompositeWrapper whose primary is wrappers[0]
+// and whose remaining entries are consulted, in list order, on Decrypt; the
+// first child whose KeyID matches the blob's embedded key id decrypts it.
+func NewCompositeWrapper(wrappers ...wrapping.Wrapper) (*CompositeWrapper, error) {
+	if len(wrappers) == 0 {
+		return nil, fmt.Errorf("composite wrapper requires at least one child wrapper")
+	}
+	return &CompositeWrapper{wrappers: wrappers}, nil
+}
+
+// ConfigureCompositeWrapper builds a CompositeWrapper from an ordered list of
+// KMS configs, such as a set of "seal" stanzas that share a "group" tag. The
+// first entry in kmsList becomes the primary.
+func ConfigureCompositeWrapper(kmsList []*KMS, logger hclog.Logger) (wrapping.Wrapper, error) {
+	if len(kmsList) == 0 {
+		return nil, fmt.Errorf("composite wrapper requires at least one seal config")
+	}
+
+	wrappers := make([]wrapping.Wrapper, 0, len(kmsList))
+	for _, kms := range kmsList {
+		var infoKeys []string
+		info := make(map[string]string)
+		wrapper, err := configureWrapper(kms, &infoKeys, &info, logger)
+		if err != nil {
+			return nil, err
+		}
+		wrappers = append(wrappers, wrapper)
+	}
+
+	return NewCompositeWrapper(wrappers...)
+}
+
+// ConfigureWrapperGroups is the entry point for configuring a full ordered
+// list of "seal" stanzas in one call, grouping by each KMS config's Group
+// field (the "group" HCL tag) before configuring anything. Stanzas sharing a
+// non-empty Group collapse into a single CompositeWrapper, built the same way
+// as ConfigureCompositeWrapper, in the order they appear within the group;
+// stanzas with no Group are configured individually via configureWrapper,
+// exactly as if this function didn't exist. infoKeys/info accumulate across
+// every stanza the same way a hand-rolled loop over configureWrapper would.
+//
+// This is the HCL-side integration point: a seal-stanza loader should call
+// this once with every parsed "seal" block instead of calling
+// configureWrapper per block, so that shared "group" tags actually produce a
+// composite seal.
+func ConfigureWrapperGroups(kmsList []*KMS, infoKeys *[]string, info *map[string]string, logger hclog.Logger) ([]wrapping.Wrapper, error) {
+	var ungrouped []*KMS
+	var groupOrder []string
+	groups := make(map[string][]*KMS)
+
+	for _, kms := range kmsList {
+		if kms.Group == "" {
+			ungrouped = append(ungrouped, kms)
+			continue
+		}
+		if _, ok := groups[kms.Group]; !ok {
+			groupOrder = append(groupOrder, kms.Group)
+		}
+		groups[kms.Group] = append(groups[kms.Group], kms)
+	}
+
+	wrappers := make([]wrapping.Wrapper, 0, len(ungrouped)+len(groupOrder))
+
+	for _, kms := range ungrouped {
+		wrapper, err := configureWrapper(kms, infoKeys, info, logger)
+		if err != nil {
+			return nil, err
+		}
+		if wrapper != nil {
+			wrappers = append(wrappers, wrapper)
+		}
+	}
+
+	for _, group := range groupOrder {
+		children := make([]wrapping.Wrapper, 0, len(groups[group]))
+		for _, kms := range groups[group] {
+			child, err := configureWrapper(kms, infoKeys, info, logger)
+			if err != nil {
+				return nil, fmt.Errorf("seal group %q: %w", group, err)
+			}
+			children = append(children, child)
+		}
+		wrapper, err := NewCompositeWrapper(children...)
+		if err != nil {
+			return nil, fmt.Errorf("seal group %q: %w", group, err)
+		}
+		wrappers = append(wrappers, wrapper)
+	}
+
+	return wrappers, nil
+}
+
+func (c *CompositeWrapper) Type() string {
+	return "composite"
+}
+
+func (c *CompositeWrapper) primary() wrapping.Wrapper {
+	return c.wrappers[0]
+}
+
+func (c *CompositeWrapper) KeyID() string {
+	return c.primary().KeyID()
+}
+
+func (c *CompositeWrapper) HMACKeyID() string {
+	return c.primary().HMACKeyID()
+}
+
+func (c *CompositeWrapper) Init(ctx context.Context) error {
+	for _, w := range c.wrappers {
+		if err := w.Init(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CompositeWrapper) Finalize(ctx context.Context) error {
+	for _, w := range c.wrappers {
+		if err := w.Finalize(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CompositeWrapper) Encrypt(ctx context.Context, plaintext []byte, aad []byte) (*wrapping.EncryptedBlobInfo, error) {
+	return c.encryptWith(ctx, c.primary(), plaintext, aad)
+}
+
+func (c *CompositeWrapper) Decrypt(ctx context.Context, blob *wrapping.EncryptedBlobInfo, aad []byte) ([]byte, error) {
+	plaintext, _, err := c.decrypt(ctx, blob, aad)
+	return plaintext, err
+}
+
+// DecryptWithMigration decrypts blob like Decrypt, but additionally returns a
+// re-wrapped envelope when the value was read via a secondary wrapper rather
+// than the primary, so the caller can persist it and migrate that value
+// forward. migrated is nil when blob was already primary-wrapped, so callers
+// should only write it back when non-nil.
+func (c *CompositeWrapper) DecryptWithMigration(ctx context.Context, blob *wrapping.EncryptedBlobInfo, aad []byte) (plaintext []byte, migrated *wrapping.EncryptedBlobInfo, err error) {
+	return c.decrypt(ctx, blob, aad)
+}
+
+func (c *CompositeWrapper) decrypt(ctx context.Context, blob *wrapping.EncryptedBlobInfo, aad []byte) ([]byte, *wrapping.EncryptedBlobInfo, error) {
+	keyID, childBlob, err := decodeCompositeEnvelope(blob.Ciphertext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, w := range c.wrappers {
+		if w.KeyID() != keyID {
+			continue
+		}
+
+		plaintext, err := w.Decrypt(ctx, childBlob, aad)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if i == 0 {
+			return plaintext, nil, nil
+		}
+
+		migrated, err := c.encryptWith(ctx, c.primary(), plaintext, aad)
+		if err != nil {
+			return nil, nil, fmt.Errorf("composite wrapper: decrypted via secondary but failed to re-wrap with primary: %w", err)
+		}
+
+		return plaintext, migrated, nil
+	}
+
+	return nil, nil, fmt.Errorf("composite wrapper: no child wrapper holds key id %q", keyID)
+}
+
+func (c *CompositeWrapper) encryptWith(ctx context.Context, w wrapping.Wrapper, plaintext []byte, aad []byte) (*wrapping.EncryptedBlobInfo, error) {
+	childBlob, err := w.Encrypt(ctx, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID := w.KeyID()
+
+	envelope, err := encodeCompositeEnvelope(keyID, childBlob)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wrapping.EncryptedBlobInfo{
+		Ciphertext: envelope,
+		Wrapped:    true,
+		KeyInfo: &wrapping.KeyInfo{
+			KeyID: keyID,
+		},
+	}, nil
+}
+
+// encodeCompositeEnvelope packs a child blob into
+// [1-byte version][2-byte keyid-len][keyid][wrapped-payload].
+func encodeCompositeEnvelope(keyID string, childBlob *wrapping.EncryptedBlobInfo) ([]byte, error) {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(childBlob); err != nil {
+		return nil, err
+	}
+
+	keyIDBytes := []byte(keyID)
+	if len(keyIDBytes) > 0xFFFF {
+		return nil, fmt.Errorf("composite wrapper: key id too long (%d bytes)", len(keyIDBytes))
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(compositeWrapperEnvelopeVersion)
+	binary.Write(buf, binary.BigEndian, uint16(len(keyIDBytes)))
+	buf.Write(keyIDBytes)
+	buf.Write(payload.Bytes())
+
+	return buf.Bytes(), nil
+}
+
+func decodeCompositeEnvelope(envelope []byte) (string, *wrapping.EncryptedBlobInfo, error) {
+	if len(envelope) < 3 {
+		return "", nil, fmt.Errorf("composite wrapper: envelope too short")
+	}
+	if envelope[0] != compositeWrapperEnvelopeVersion {
+		return "", nil, fmt.Errorf("composite wrapper: unsupported envelope version %d", envelope[0])
+	}
+
+	keyIDLen := int(binary.BigEndian.Uint16(envelope[1:3]))
+	if len(envelope) < 3+keyIDLen {
+		return "", nil, fmt.Errorf("composite wrapper: envelope truncated")
+	}
+
+	keyID := string(envelope[3 : 3+keyIDLen])
+
+	var childBlob wrapping.EncryptedBlobInfo
+	if err := gob.NewDecoder(bytes.NewReader(envelope[3+keyIDLen:])).Decode(&childBlob); err != nil {
+		return "", nil, err
+	}
+
+	return keyID, &childBlob, nil
+}
@@ -0,0 +1,183 @@
+// +build !enterprise
+
+package configutil
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+)
+
+// fakeChildWrapper is a minimal wrapping.Wrapper whose "encryption" is just
+// tagging the plaintext with its key id, so tests can assert exactly which
+// child a blob round-trips through.
+type fakeChildWrapper struct {
+	keyID string
+}
+
+func (f *fakeChildWrapper) Type() string                     { return "fake" }
+func (f *fakeChildWrapper) KeyID() string                    { return f.keyID }
+func (f *fakeChildWrapper) HMACKeyID() string                { return "" }
+func (f *fakeChildWrapper) Init(_ context.Context) error     { return nil }
+func (f *fakeChildWrapper) Finalize(_ context.Context) error { return nil }
+
+func (f *fakeChildWrapper) Encrypt(_ context.Context, plaintext []byte, _ []byte) (*wrapping.EncryptedBlobInfo, error) {
+	return &wrapping.EncryptedBlobInfo{
+		Ciphertext: append([]byte(f.keyID+":"), plaintext...),
+		KeyInfo:    &wrapping.KeyInfo{KeyID: f.keyID},
+	}, nil
+}
+
+func (f *fakeChildWrapper) Decrypt(_ context.Context, blob *wrapping.EncryptedBlobInfo, _ []byte) ([]byte, error) {
+	prefix := []byte(f.keyID + ":")
+	if !bytes.HasPrefix(blob.Ciphertext, prefix) {
+		return nil, errNotMine
+	}
+	return blob.Ciphertext[len(prefix):], nil
+}
+
+var errNotMine = fakeDecryptError{}
+
+type fakeDecryptError struct{}
+
+func (fakeDecryptError) Error() string { return "fakeChildWrapper: blob was not wrapped by this key" }
+
+func TestCompositeWrapper_EnvelopeRoundTrip(t *testing.T) {
+	primary := &fakeChildWrapper{keyID: "primary-key"}
+	secondary := &fakeChildWrapper{keyID: "secondary-key"}
+	c, err := NewCompositeWrapper(primary, secondary)
+	if err != nil {
+		t.Fatalf("NewCompositeWrapper: %v", err)
+	}
+
+	blob, err := c.Encrypt(context.Background(), []byte("hello"), nil)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	keyID, childBlob, err := decodeCompositeEnvelope(blob.Ciphertext)
+	if err != nil {
+		t.Fatalf("decodeCompositeEnvelope: %v", err)
+	}
+	if keyID != primary.keyID {
+		t.Fatalf("envelope key id = %q, want %q", keyID, primary.keyID)
+	}
+	if !bytes.Equal(childBlob.Ciphertext, []byte("primary-key:hello")) {
+		t.Fatalf("child blob ciphertext = %q, want %q", childBlob.Ciphertext, "primary-key:hello")
+	}
+
+	plaintext, err := c.Decrypt(context.Background(), blob, nil)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(plaintext) != "hello" {
+		t.Fatalf("Decrypt plaintext = %q, want %q", plaintext, "hello")
+	}
+}
+
+func TestCompositeWrapper_Decrypt_DispatchesToSecondaryWithoutMigrating(t *testing.T) {
+	primary := &fakeChildWrapper{keyID: "primary-key"}
+	secondary := &fakeChildWrapper{keyID: "secondary-key"}
+	c, err := NewCompositeWrapper(primary, secondary)
+	if err != nil {
+		t.Fatalf("NewCompositeWrapper: %v", err)
+	}
+
+	secondaryBlob, err := c.encryptWith(context.Background(), secondary, []byte("legacy"), nil)
+	if err != nil {
+		t.Fatalf("encryptWith(secondary): %v", err)
+	}
+
+	plaintext, err := c.Decrypt(context.Background(), secondaryBlob, nil)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(plaintext) != "legacy" {
+		t.Fatalf("Decrypt plaintext = %q, want %q", plaintext, "legacy")
+	}
+
+	// Plain Decrypt must not silently re-wrap with the primary: the envelope
+	// a caller stored is still the one that came back.
+	keyID, _, err := decodeCompositeEnvelope(secondaryBlob.Ciphertext)
+	if err != nil {
+		t.Fatalf("decodeCompositeEnvelope: %v", err)
+	}
+	if keyID != secondary.keyID {
+		t.Fatalf("original envelope was mutated: key id now %q, want unchanged %q", keyID, secondary.keyID)
+	}
+}
+
+func TestCompositeWrapper_DecryptWithMigration(t *testing.T) {
+	primary := &fakeChildWrapper{keyID: "primary-key"}
+	secondary := &fakeChildWrapper{keyID: "secondary-key"}
+	c, err := NewCompositeWrapper(primary, secondary)
+	if err != nil {
+		t.Fatalf("NewCompositeWrapper: %v", err)
+	}
+
+	secondaryBlob, err := c.encryptWith(context.Background(), secondary, []byte("legacy"), nil)
+	if err != nil {
+		t.Fatalf("encryptWith(secondary): %v", err)
+	}
+
+	plaintext, migrated, err := c.DecryptWithMigration(context.Background(), secondaryBlob, nil)
+	if err != nil {
+		t.Fatalf("DecryptWithMigration: %v", err)
+	}
+	if string(plaintext) != "legacy" {
+		t.Fatalf("plaintext = %q, want %q", plaintext, "legacy")
+	}
+	if migrated == nil {
+		t.Fatal("migrated envelope is nil, want a re-wrapped primary envelope")
+	}
+
+	migratedKeyID, _, err := decodeCompositeEnvelope(migrated.Ciphertext)
+	if err != nil {
+		t.Fatalf("decodeCompositeEnvelope(migrated): %v", err)
+	}
+	if migratedKeyID != primary.keyID {
+		t.Fatalf("migrated envelope key id = %q, want %q", migratedKeyID, primary.keyID)
+	}
+
+	migratedPlaintext, err := c.Decrypt(context.Background(), migrated, nil)
+	if err != nil {
+		t.Fatalf("Decrypt(migrated): %v", err)
+	}
+	if string(migratedPlaintext) != "legacy" {
+		t.Fatalf("Decrypt(migrated) plaintext = %q, want %q", migratedPlaintext, "legacy")
+	}
+
+	// A blob already wrapped by the primary has nothing to migrate.
+	primaryBlob, err := c.Encrypt(context.Background(), []byte("fresh"), nil)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	_, migratedAgain, err := c.DecryptWithMigration(context.Background(), primaryBlob, nil)
+	if err != nil {
+		t.Fatalf("DecryptWithMigration(primary blob): %v", err)
+	}
+	if migratedAgain != nil {
+		t.Fatalf("migrated envelope for an already-primary blob should be nil, got %v", migratedAgain)
+	}
+}
+
+func TestDecodeCompositeEnvelope_Errors(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload []byte
+	}{
+		{"too short", []byte{1, 0}},
+		{"bad version", append([]byte{99, 0, 0}, []byte("rest")...)},
+		{"truncated key id", []byte{1, 0, 5, 'a', 'b'}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := decodeCompositeEnvelope(tc.payload); err == nil {
+				t.Fatalf("decodeCompositeEnvelope(%v): expected error, got nil", tc.payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+// +build softhsm
+
+package configutil
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strconv"
+
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	"github.com/miekg/pkcs11"
+)
+
+func init() {
+	RegisterWrapperProvider(string(wrapping.PKCS11), func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
+		return GetPKCS11KMSFunc(opts, kms)
+	})
+}
+
+// GetPKCS11KMSFunc builds a wrapping.Wrapper backed by a community PKCS#11
+// library (SoftHSMv2, a Yubikey's PIV/PKCS#11 module, etc.) instead of the
+// enterprise HSM binary. It only exists under the "softhsm" build tag; a
+// default build keeps hitting the "requires the Vault Enterprise HSM binary"
+// error in configureWrapper.
+var GetPKCS11KMSFunc = func(opts *wrapping.WrapperOptions, kms *KMS) (wrapping.Wrapper, map[string]string, error) {
+	wrapper := newPKCS11Wrapper(opts)
+	wrapperInfo, err := wrapper.SetConfig(kms.Config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := make(map[string]string)
+	if wrapperInfo != nil {
+		info["PKCS11 Key Label"] = wrapperInfo["key_label"]
+		info["PKCS11 Mechanism"] = wrapperInfo["mechanism"]
+	}
+	return wrapper, info, nil
+}
+
+const (
+	defaultPKCS11Mechanism = "AES-GCM"
+	pkcs11PINEnvVar        = "VAULT_PKCS11_PIN"
+)
+
+// pkcs11Wrapper implements wrapping.Wrapper against a PKCS#11 token reached
+// via github.com/miekg/pkcs11. It supports the AES-GCM mechanism today;
+// RSA-OAEP is a recognized mechanism name but rejected at SetConfig time
+// since it's not yet wired up.
+type pkcs11Wrapper struct {
+	opts *wrapping.WrapperOptions
+
+	ctx  *pkcs11.Ctx
+	lib  string
+	slot uint
+
+	tokenLabel string
+	pin        string
+	keyLabel   string
+	mechanism  string
+
+	session   pkcs11.SessionHandle
+	keyHandle pkcs11.ObjectHandle
+}
+
+func newPKCS11Wrapper(opts *wrapping.WrapperOptions) *pkcs11Wrapper {
+	if opts == nil {
+		opts = new(wrapping.WrapperOptions)
+	}
+	return &pkcs11Wrapper{opts: opts}
+}
+
+func (p *pkcs11Wrapper) Type() string {
+	return string(wrapping.PKCS11)
+}
+
+func (p *pkcs11Wrapper) KeyID() string {
+	return p.keyLabel
+}
+
+func (p *pkcs11Wrapper) HMACKeyID() string {
+	return ""
+}
+
+func (p *pkcs11Wrapper) SetConfig(config map[string]string) (map[string]string, error) {
+	if config == nil {
+		config = make(map[string]string)
+	}
+
+	p.lib = config["lib"]
+	if p.lib == "" {
+		return nil, fmt.Errorf("'lib' is required for pkcs11 seal configuration")
+	}
+
+	p.tokenLabel = config["token_label"]
+	p.keyLabel = config["key_label"]
+	if p.keyLabel == "" {
+		return nil, fmt.Errorf("'key_label' is required for pkcs11 seal configuration")
+	}
+
+	p.mechanism = config["mechanism"]
+	if p.mechanism == "" {
+		p.mechanism = defaultPKCS11Mechanism
+	}
+	switch p.mechanism {
+	case "AES-GCM":
+	case "RSA-OAEP":
+		return nil, fmt.Errorf("pkcs11 mechanism %q is not yet implemented", p.mechanism)
+	default:
+		return nil, fmt.Errorf("unsupported pkcs11 mechanism %q", p.mechanism)
+	}
+
+	p.pin = config["pin"]
+	if p.pin == "" {
+		p.pin = os.Getenv(pkcs11PINEnvVar)
+	}
+	if p.pin == "" {
+		return nil, fmt.Errorf("'pin' is required for pkcs11 seal configuration, via config or %s", pkcs11PINEnvVar)
+	}
+
+	if err := p.openSession(config["slot"]); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"lib":         p.lib,
+		"key_label":   p.keyLabel,
+		"mechanism":   p.mechanism,
+		"token_label": p.tokenLabel,
+	}, nil
+}
+
+func (p *pkcs11Wrapper) openSession(slotConfig string) error {
+	ctx := pkcs11.New(p.lib)
+	if ctx == nil {
+		return fmt.Errorf("unable to load pkcs11 library %q", p.lib)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return fmt.Errorf("error initializing pkcs11 library: %w", err)
+	}
+
+	slot, err := resolvePKCS11Slot(ctx, slotConfig, p.tokenLabel)
+	if err != nil {
+		ctx.Destroy()
+		return err
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		ctx.Destroy()
+		return fmt.Errorf("error opening pkcs11 session: %w", err)
+	}
+
+	if err := ctx.Login(session, pkcs11.CKU_USER, p.pin); err != nil {
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return fmt.Errorf("error logging into pkcs11 token: %w", err)
+	}
+
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, p.keyLabel),
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		ctx.Logout(session)
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return fmt.Errorf("error finding pkcs11 key %q: %w", p.keyLabel, err)
+	}
+	handles, _, err := ctx.FindObjects(session, 1)
+	ctx.FindObjectsFinal(session)
+	if err != nil {
+		ctx.Logout(session)
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return fmt.Errorf("error finding pkcs11 key %q: %w", p.keyLabel, err)
+	}
+	if len(handles) == 0 {
+		ctx.Logout(session)
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return fmt.Errorf("pkcs11 key with label %q not found", p.keyLabel)
+	}
+
+	p.ctx = ctx
+	p.slot = slot
+	p.session = session
+	p.keyHandle = handles[0]
+	return nil
+}
+
+func resolvePKCS11Slot(ctx *pkcs11.Ctx, slotConfig, tokenLabel string) (uint, error) {
+	if slotConfig != "" {
+		slot, err := strconv.ParseUint(slotConfig, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid pkcs11 'slot' config %q: %w", slotConfig, err)
+		}
+		return uint(slot), nil
+	}
+
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("error listing pkcs11 slots: %w", err)
+	}
+	if len(slots) == 0 {
+		return 0, fmt.Errorf("no pkcs11 slots with a token present")
+	}
+
+	if tokenLabel == "" {
+		return slots[0], nil
+	}
+
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if info.Label == tokenLabel {
+			return slot, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no pkcs11 token found with label %q", tokenLabel)
+}
+
+func (p *pkcs11Wrapper) Init(_ context.Context) error {
+	return nil
+}
+
+func (p *pkcs11Wrapper) Finalize(_ context.Context) error {
+	if p.ctx == nil {
+		return nil
+	}
+	p.ctx.Logout(p.session)
+	p.ctx.CloseSession(p.session)
+	p.ctx.Destroy()
+	return nil
+}
+
+func (p *pkcs11Wrapper) Encrypt(_ context.Context, plaintext []byte, _ []byte) (*wrapping.EncryptedBlobInfo, error) {
+	if p.mechanism != "AES-GCM" {
+		return nil, fmt.Errorf("pkcs11 mechanism %q is not yet implemented", p.mechanism)
+	}
+
+	iv := make([]byte, 12)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("error generating pkcs11 IV: %w", err)
+	}
+
+	gcmParams := pkcs11.NewGCMParams(iv, nil, 128)
+	defer gcmParams.Free()
+
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, gcmParams)}
+	if err := p.ctx.EncryptInit(p.session, mech, p.keyHandle); err != nil {
+		return nil, fmt.Errorf("error initializing pkcs11 encrypt: %w", err)
+	}
+	ciphertext, err := p.ctx.Encrypt(p.session, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting via pkcs11: %w", err)
+	}
+
+	return &wrapping.EncryptedBlobInfo{
+		Ciphertext: ciphertext,
+		IV:         iv,
+		KeyInfo: &wrapping.KeyInfo{
+			KeyID:     p.keyLabel,
+			Mechanism: uint64(pkcs11.CKM_AES_GCM),
+		},
+	}, nil
+}
+
+func (p *pkcs11Wrapper) Decrypt(_ context.Context, blob *wrapping.EncryptedBlobInfo, _ []byte) ([]byte, error) {
+	if p.mechanism != "AES-GCM" {
+		return nil, fmt.Errorf("pkcs11 mechanism %q is not yet implemented", p.mechanism)
+	}
+
+	gcmParams := pkcs11.NewGCMParams(blob.IV, nil, 128)
+	defer gcmParams.Free()
+
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, gcmParams)}
+	if err := p.ctx.DecryptInit(p.session, mech, p.keyHandle); err != nil {
+		return nil, fmt.Errorf("error initializing pkcs11 decrypt: %w", err)
+	}
+	plaintext, err := p.ctx.Decrypt(p.session, blob.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting via pkcs11: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// GetRandom implements EntropySourcer by pulling n bytes straight from the
+// token's C_GenerateRandom.
+func (p *pkcs11Wrapper) GetRandom(_ context.Context, n int) ([]byte, error) {
+	return p.ctx.GenerateRandom(p.session, n)
+}
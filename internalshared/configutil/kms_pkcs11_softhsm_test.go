@@ -0,0 +1,177 @@
+// +build softhsm
+
+package configutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+)
+
+const (
+	softHSMTestTokenLabel = "vault-test"
+	softHSMTestKeyLabel   = "vault-test-key"
+	softHSMTestPIN        = "1234"
+	softHSMTestSOPIN      = "5678"
+)
+
+// softHSMLibraryPaths are where Debian/Ubuntu, Fedora/RHEL, and Homebrew
+// install libsofthsm2.so, checked in that order when
+// VAULT_PKCS11_SOFTHSM_LIB isn't set.
+var softHSMLibraryPaths = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+}
+
+// TestPKCS11Wrapper_SoftHSMIntegration exercises SetConfig -> Encrypt ->
+// Decrypt against a real SoftHSMv2 token. It provisions its own token and
+// AES key under a throwaway SOFTHSM2_CONF via softhsm2-util/pkcs11-tool, so
+// it runs automatically in any CI image with the softhsm2 and opensc
+// packages installed, without any manual setup. It's skipped, rather than
+// failed, when those tools or a SoftHSM2 library aren't present, since this
+// package's default build doesn't carry a hard dependency on either.
+//
+// A pre-provisioned token can be used instead by setting
+// VAULT_PKCS11_SOFTHSM_LIB, VAULT_PKCS11_SOFTHSM_TOKEN_LABEL,
+// VAULT_PKCS11_SOFTHSM_KEY_LABEL, and VAULT_PKCS11_PIN, which skips
+// provisioning entirely.
+func TestPKCS11Wrapper_SoftHSMIntegration(t *testing.T) {
+	lib, tokenLabel, keyLabel, pin := softHSMTestConfig(t)
+
+	wrapper := newPKCS11Wrapper(nil)
+	_, err := wrapper.SetConfig(map[string]string{
+		"lib":         lib,
+		"token_label": tokenLabel,
+		"key_label":   keyLabel,
+		"pin":         pin,
+	})
+	if err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	defer wrapper.Finalize(context.Background())
+
+	plaintext := []byte("vault-pkcs11-softhsm-integration-test")
+
+	blob, err := wrapper.Encrypt(context.Background(), plaintext, nil)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if bytes.Equal(blob.Ciphertext, plaintext) {
+		t.Fatal("ciphertext equals plaintext, encryption did not happen")
+	}
+
+	got, err := wrapper.Decrypt(context.Background(), blob, nil)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("decrypted plaintext = %q, want %q", got, plaintext)
+	}
+
+	if _, ok := wrapping.Wrapper(wrapper).(EntropySourcer); !ok {
+		t.Fatal("pkcs11Wrapper does not implement EntropySourcer")
+	}
+	random, err := wrapper.GetRandom(context.Background(), 32)
+	if err != nil {
+		t.Fatalf("GetRandom failed: %v", err)
+	}
+	if len(random) != 32 {
+		t.Fatalf("GetRandom returned %d bytes, want 32", len(random))
+	}
+}
+
+// softHSMTestConfig returns the lib/token_label/key_label/pin to run the
+// integration test against, either a manually provisioned token (env vars
+// set) or a freshly provisioned one (softhsm2-util/pkcs11-tool present). It
+// calls t.Skip itself when neither is available.
+func softHSMTestConfig(t *testing.T) (lib, tokenLabel, keyLabel, pin string) {
+	t.Helper()
+
+	if lib := os.Getenv("VAULT_PKCS11_SOFTHSM_LIB"); lib != "" {
+		keyLabel := os.Getenv("VAULT_PKCS11_SOFTHSM_KEY_LABEL")
+		if keyLabel == "" {
+			t.Fatal("VAULT_PKCS11_SOFTHSM_KEY_LABEL must be set alongside VAULT_PKCS11_SOFTHSM_LIB")
+		}
+		pin := os.Getenv(pkcs11PINEnvVar)
+		if pin == "" {
+			t.Fatalf("%s must be set alongside VAULT_PKCS11_SOFTHSM_LIB", pkcs11PINEnvVar)
+		}
+		return lib, os.Getenv("VAULT_PKCS11_SOFTHSM_TOKEN_LABEL"), keyLabel, pin
+	}
+
+	lib = findSoftHSMLibrary()
+	if lib == "" {
+		t.Skip("no libsofthsm2.so found (set VAULT_PKCS11_SOFTHSM_LIB or install the softhsm2 package), skipping SoftHSMv2 integration test")
+	}
+	if _, err := exec.LookPath("softhsm2-util"); err != nil {
+		t.Skip("softhsm2-util not found in PATH, skipping SoftHSMv2 integration test")
+	}
+	if _, err := exec.LookPath("pkcs11-tool"); err != nil {
+		t.Skip("pkcs11-tool not found in PATH (install the opensc package), skipping SoftHSMv2 integration test")
+	}
+
+	provisionSoftHSMToken(t, lib)
+	return lib, softHSMTestTokenLabel, softHSMTestKeyLabel, softHSMTestPIN
+}
+
+func findSoftHSMLibrary() string {
+	for _, path := range softHSMLibraryPaths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// provisionSoftHSMToken points SOFTHSM2_CONF at a throwaway token directory
+// under t.TempDir(), then shells out to softhsm2-util and pkcs11-tool to
+// initialize a token and generate an AES-256 key under
+// softHSMTestTokenLabel/softHSMTestKeyLabel. The config and token directory
+// are removed automatically when the test completes.
+func provisionSoftHSMToken(t *testing.T, lib string) {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	tokenDir := filepath.Join(tmpDir, "tokens")
+	if err := os.MkdirAll(tokenDir, 0o700); err != nil {
+		t.Fatalf("creating softhsm token dir: %v", err)
+	}
+
+	confPath := filepath.Join(tmpDir, "softhsm2.conf")
+	conf := fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\n", tokenDir)
+	if err := os.WriteFile(confPath, []byte(conf), 0o600); err != nil {
+		t.Fatalf("writing softhsm2.conf: %v", err)
+	}
+	t.Setenv("SOFTHSM2_CONF", confPath)
+
+	runSoftHSMTool(t, "softhsm2-util", "--init-token", "--free",
+		"--label", softHSMTestTokenLabel,
+		"--pin", softHSMTestPIN,
+		"--so-pin", softHSMTestSOPIN)
+
+	runSoftHSMTool(t, "pkcs11-tool", "--module", lib,
+		"--token-label", softHSMTestTokenLabel,
+		"--pin", softHSMTestPIN,
+		"--keygen", "--key-type", "AES:32",
+		"--label", softHSMTestKeyLabel)
+}
+
+func runSoftHSMTool(t *testing.T, name string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), "SOFTHSM2_CONF="+os.Getenv("SOFTHSM2_CONF"))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s %v: %v\n%s", name, args, err, out)
+	}
+}
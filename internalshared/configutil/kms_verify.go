@@ -0,0 +1,187 @@
+// +build !enterprise
+
+package configutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	"github.com/hashicorp/go-kms-wrapping/wrappers/awskms"
+	"github.com/hashicorp/go-kms-wrapping/wrappers/azurekeyvault"
+	"github.com/hashicorp/go-kms-wrapping/wrappers/gcpckms"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+// Typed errors returned by VerifyWrapper so callers, including a future
+// "vault operator seal-status --verify" command, get an actionable
+// diagnostic instead of an opaque SetConfig failure.
+var (
+	ErrWrapperUnreachable      = errors.New("wrapper backend is unreachable")
+	ErrWrapperPermissionDenied = errors.New("caller does not have permission to use the wrapper key")
+	ErrWrapperKeyNotFound      = errors.New("wrapper key was not found")
+	ErrWrapperKeyDisabled      = errors.New("wrapper key is disabled or pending deletion")
+)
+
+// KeyStatusChecker is implemented by wrapper adapters that can report
+// whether their backing key is active, e.g. AWS KMS's DescribeKey, GCP KMS's
+// GetCryptoKey, or Azure Key Vault's GetKey. VerifyWrapper consults
+// it, when present, to turn provider-specific key states into one of the
+// typed errors above before even attempting a round trip.
+type KeyStatusChecker interface {
+	CheckKeyStatus(ctx context.Context) error
+}
+
+const verifyWrapperCanaryPlaintext = "vault-wrapper-verify-canary"
+
+// VerifyWrapper performs an end-to-end Encrypt/Decrypt round trip of a small
+// canary payload against w. It's run as the opt-in KMS.VerifyOnLoad check at
+// the end of configureWrapper, and is exposed standalone for a future
+// "vault operator seal-status --verify" command.
+func VerifyWrapper(ctx context.Context, w wrapping.Wrapper) error {
+	if checker, ok := w.(KeyStatusChecker); ok {
+		if err := checker.CheckKeyStatus(ctx); err != nil {
+			return err
+		}
+	}
+
+	blob, err := w.Encrypt(ctx, []byte(verifyWrapperCanaryPlaintext), nil)
+	if err != nil {
+		return classifyWrapperError(err)
+	}
+
+	plaintext, err := w.Decrypt(ctx, blob, nil)
+	if err != nil {
+		return classifyWrapperError(err)
+	}
+
+	if string(plaintext) != verifyWrapperCanaryPlaintext {
+		return fmt.Errorf("wrapper verify round trip returned mismatched plaintext")
+	}
+
+	return nil
+}
+
+// classifyWrapperError maps a raw Encrypt/Decrypt/key-status error to one of
+// the typed Err* sentinels above by inspecting the underlying provider error
+// (AWS's awserr.Error code, a GCP gRPC status code, or an Azure
+// autorest.DetailedError status code), falling back to ErrWrapperUnreachable
+// since that covers the most common failure modes (network errors,
+// throttling, expired credentials) that don't fit the other buckets.
+func classifyWrapperError(err error) error {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "AccessDeniedException", "UnrecognizedClientException":
+			return fmt.Errorf("%w: %v", ErrWrapperPermissionDenied, err)
+		case kms.ErrCodeNotFoundException, kms.ErrCodeInvalidArnException:
+			return fmt.Errorf("%w: %v", ErrWrapperKeyNotFound, err)
+		case kms.ErrCodeDisabledException, kms.ErrCodeKeyUnavailableException:
+			return fmt.Errorf("%w: %v", ErrWrapperKeyDisabled, err)
+		default:
+			return fmt.Errorf("%w: %v", ErrWrapperUnreachable, err)
+		}
+	}
+
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.PermissionDenied, codes.Unauthenticated:
+			return fmt.Errorf("%w: %v", ErrWrapperPermissionDenied, err)
+		case codes.NotFound:
+			return fmt.Errorf("%w: %v", ErrWrapperKeyNotFound, err)
+		case codes.FailedPrecondition:
+			return fmt.Errorf("%w: %v", ErrWrapperKeyDisabled, err)
+		default:
+			return fmt.Errorf("%w: %v", ErrWrapperUnreachable, err)
+		}
+	}
+
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		switch detailedErr.StatusCode {
+		case 401, 403:
+			return fmt.Errorf("%w: %v", ErrWrapperPermissionDenied, err)
+		case 404:
+			return fmt.Errorf("%w: %v", ErrWrapperKeyNotFound, err)
+		default:
+			return fmt.Errorf("%w: %v", ErrWrapperUnreachable, err)
+		}
+	}
+
+	return fmt.Errorf("%w: %v", ErrWrapperUnreachable, err)
+}
+
+// awsKeyStatusChecker adapts an awskms.Wrapper into a KeyStatusChecker via
+// DescribeKey, so VerifyWrapper can reject a key that's disabled or pending
+// deletion before it ever attempts a round trip.
+type awsKeyStatusChecker struct {
+	*awskms.Wrapper
+}
+
+func (a *awsKeyStatusChecker) CheckKeyStatus(ctx context.Context) error {
+	out, err := a.Client().DescribeKeyWithContext(ctx, &kms.DescribeKeyInput{
+		KeyId: aws.String(a.KeyID()),
+	})
+	if err != nil {
+		return classifyWrapperError(err)
+	}
+
+	switch aws.StringValue(out.KeyMetadata.KeyState) {
+	case kms.KeyStateEnabled:
+		return nil
+	default:
+		return fmt.Errorf("%w: key state is %q", ErrWrapperKeyDisabled, aws.StringValue(out.KeyMetadata.KeyState))
+	}
+}
+
+// gcpKeyStatusChecker adapts a gcpckms.Wrapper into a KeyStatusChecker via
+// GetCryptoKey, checking the primary crypto key version's state.
+type gcpKeyStatusChecker struct {
+	*gcpckms.Wrapper
+	cryptoKeyName string
+}
+
+func (g *gcpKeyStatusChecker) CheckKeyStatus(ctx context.Context) error {
+	key, err := g.Client().GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: g.cryptoKeyName})
+	if err != nil {
+		return classifyWrapperError(err)
+	}
+
+	if key.Primary == nil {
+		return fmt.Errorf("%w: crypto key has no primary version", ErrWrapperKeyDisabled)
+	}
+
+	switch key.Primary.State {
+	case kmspb.CryptoKeyVersion_ENABLED:
+		return nil
+	default:
+		return fmt.Errorf("%w: primary version state is %q", ErrWrapperKeyDisabled, key.Primary.State)
+	}
+}
+
+// azureKeyStatusChecker adapts an azurekeyvault.Wrapper into a
+// KeyStatusChecker via GetKey, checking the key's Enabled attribute.
+type azureKeyStatusChecker struct {
+	*azurekeyvault.Wrapper
+	keyName string
+}
+
+func (v *azureKeyStatusChecker) CheckKeyStatus(ctx context.Context) error {
+	bundle, err := v.Client().GetKey(ctx, v.BaseURL(), v.keyName, "")
+	if err != nil {
+		return classifyWrapperError(err)
+	}
+
+	if bundle.Attributes != nil && bundle.Attributes.Enabled != nil && !*bundle.Attributes.Enabled {
+		return fmt.Errorf("%w: key %q is disabled", ErrWrapperKeyDisabled, v.keyName)
+	}
+
+	return nil
+}